@@ -0,0 +1,286 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/algorand/go-deadlock"
+)
+
+// ExemplarMaxRunes is the OpenMetrics limit on the combined UTF-8 rune
+// count of an exemplar's label names and values (including the
+// synthetic "trace_id" label AddWithExemplar adds).
+const ExemplarMaxRunes = 128
+
+// exemplar captures the most recent trace-linked sample recorded for a
+// single label-set via AddWithExemplar.
+type exemplar struct {
+	labels map[string]string
+	ts     time.Time
+}
+
+// counterValue tracks one label-set's accumulated value plus, if any,
+// the most recent exemplar recorded for it.
+type counterValue struct {
+	intValue   uint64
+	floatValue float64
+	labels     map[string]string
+	exemplar   *exemplar
+}
+
+// Counter is a monotonically increasing metric, broken down by an
+// arbitrary set of labels supplied at call time.
+type Counter struct {
+	deadlock.Mutex
+	name   MetricName
+	values map[string]*counterValue
+
+	// fastValue, fastFloatBits and fastLabels are set only for counters
+	// handed out by CounterVec.WithLabelValues: their label-set is fixed
+	// at creation, so Inc/Add/AddUint64/GetUint64Value operate on them
+	// with plain atomic ops instead of taking the mutex and walking
+	// values. fastValue holds whole-number deltas (Inc/AddUint64);
+	// fastFloatBits holds the math.Float64bits accumulation of any
+	// fractional Add deltas, updated via a lock-free CAS loop.
+	fastValue     *uint64
+	fastFloatBits *uint64
+	fastLabels    map[string]string
+}
+
+// MakeCounter creates a new Counter and registers it with the
+// DefaultRegistry.
+func MakeCounter(name MetricName) *Counter {
+	c := &Counter{
+		name:   name,
+		values: make(map[string]*counterValue),
+	}
+	DefaultRegistry.Register(c)
+	return c
+}
+
+// total returns the label-set's combined integer and float contributions
+// as a single float64 sample value.
+func (cv *counterValue) total() float64 {
+	return float64(cv.intValue) + cv.floatValue
+}
+
+func (counter *Counter) valueFor(labels map[string]string) *counterValue {
+	key := labelsToString(labels)
+	v, ok := counter.values[key]
+	if !ok {
+		v = &counterValue{labels: labels}
+		counter.values[key] = v
+	}
+	return v
+}
+
+// addFloat64Atomic adds delta to the float64 accumulated in *bits (stored
+// as math.Float64bits) via a lock-free compare-and-swap loop, since Go
+// has no native atomic float64 add.
+func addFloat64Atomic(bits *uint64, delta float64) {
+	for {
+		old := atomic.LoadUint64(bits)
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(bits, old, next) {
+			return
+		}
+	}
+}
+
+// Add increments the counter for the given label-set by value, and
+// forwards the delta to any Sink registered with DefaultRegistry (e.g. a
+// StatsDSink). For a counter returned by CounterVec.WithLabelValues,
+// labels is ignored (its label-set was fixed at creation) and the update
+// is applied to a dedicated float64 accumulator with a CAS loop, so
+// fractional and negative deltas are preserved exactly, the same as the
+// slow path's floatValue.
+func (counter *Counter) Add(value float64, labels map[string]string) {
+	if counter.fastValue != nil {
+		addFloat64Atomic(counter.fastFloatBits, value)
+		DefaultRegistry.dispatchCount(counter.name.Name, counter.fastLabels, value)
+		return
+	}
+	counter.Lock()
+	counter.valueFor(labels).floatValue += value
+	counter.Unlock()
+	DefaultRegistry.dispatchCount(counter.name.Name, labels, value)
+}
+
+// AddUint64 increments the counter for the given label-set by value, and
+// forwards the delta to any Sink registered with DefaultRegistry (e.g. a
+// StatsDSink). For a counter returned by CounterVec.WithLabelValues,
+// labels is ignored (its label-set was fixed at creation) and the update
+// is a single atomic add.
+func (counter *Counter) AddUint64(value uint64, labels map[string]string) {
+	if counter.fastValue != nil {
+		atomic.AddUint64(counter.fastValue, value)
+		DefaultRegistry.dispatchCount(counter.name.Name, counter.fastLabels, float64(value))
+		return
+	}
+	counter.Lock()
+	counter.valueFor(labels).intValue += value
+	counter.Unlock()
+	DefaultRegistry.dispatchCount(counter.name.Name, labels, float64(value))
+}
+
+// Inc increments the counter for the given label-set by one.
+func (counter *Counter) Inc(labels map[string]string) {
+	counter.AddUint64(1, labels)
+}
+
+// AddWithExemplar increments the counter like Add, and records exemplar
+// (together with traceID and ts) as the most recent OpenMetrics exemplar
+// for this label-set. Per the OpenMetrics spec, the combined UTF-8 rune
+// count of the exemplar's label names and values may not exceed
+// ExemplarMaxRunes; AddWithExemplar rejects the exemplar with an error
+// in that case without incrementing the counter. It also rejects
+// counters returned by CounterVec.WithLabelValues: their fast path has
+// no map of per-label-set values to attach an exemplar to.
+func (counter *Counter) AddWithExemplar(value float64, labels map[string]string, exemplarLabels map[string]string, traceID string, ts time.Time) error {
+	if counter.fastValue != nil {
+		return fmt.Errorf("metrics: AddWithExemplar is not supported on a CounterVec-backed counter")
+	}
+
+	combined := make(map[string]string, len(exemplarLabels)+1)
+	for k, v := range exemplarLabels {
+		combined[k] = v
+	}
+	if traceID != "" {
+		combined["trace_id"] = traceID
+	}
+
+	runes := 0
+	for k, v := range combined {
+		runes += utf8.RuneCountInString(k) + utf8.RuneCountInString(v)
+	}
+	if runes > ExemplarMaxRunes {
+		return fmt.Errorf("metrics: exemplar exceeds %d runes (got %d)", ExemplarMaxRunes, runes)
+	}
+
+	counter.Lock()
+	cv := counter.valueFor(labels)
+	cv.floatValue += value
+	cv.exemplar = &exemplar{labels: combined, ts: ts}
+	counter.Unlock()
+	DefaultRegistry.dispatchCount(counter.name.Name, labels, value)
+	return nil
+}
+
+// GetUint64Value returns the integer portion of the no-label counter
+// value; it's used by callers that only ever increment without labels.
+func (counter *Counter) GetUint64Value() uint64 {
+	if counter.fastValue != nil {
+		return atomic.LoadUint64(counter.fastValue)
+	}
+	counter.Lock()
+	defer counter.Unlock()
+	if v, ok := counter.values[""]; ok {
+		return v.intValue
+	}
+	return 0
+}
+
+// WriteMetric writes the counter in classic Prometheus text exposition
+// format: one HELP/TYPE header followed by one line per label-set. A
+// counter returned by CounterVec.WithLabelValues is ordinarily rendered
+// by its parent CounterVec instead, but remains self-describing here.
+func (counter *Counter) WriteMetric(buf *strings.Builder, parentLabels string) {
+	if counter.fastValue != nil {
+		writeHeader(buf, counter.name, "counter")
+		total := float64(atomic.LoadUint64(counter.fastValue)) + math.Float64frombits(atomic.LoadUint64(counter.fastFloatBits))
+		buf.WriteString(sampleLine(counter.name.Name, joinLabels(parentLabels, labelsToString(counter.fastLabels)), total))
+		buf.WriteString("\n")
+		return
+	}
+	counter.Lock()
+	defer counter.Unlock()
+	writeHeader(buf, counter.name, "counter")
+	if len(counter.values) == 0 {
+		buf.WriteString(sampleLine(counter.name.Name, parentLabels, 0))
+		buf.WriteString("\n")
+		return
+	}
+	for _, v := range counter.values {
+		buf.WriteString(sampleLine(counter.name.Name, joinLabels(parentLabels, labelsToString(v.labels)), v.total()))
+		buf.WriteString("\n")
+	}
+}
+
+// WriteOpenMetric writes the counter in OpenMetrics text format: the
+// series name carries the spec-required "_total" suffix, and the most
+// recent exemplar recorded via AddWithExemplar (if any) is appended to
+// its sample line as "# {labels} value timestamp", with timestamp in
+// fractional seconds since epoch.
+func (counter *Counter) WriteOpenMetric(buf *strings.Builder, parentLabels string) {
+	counter.Lock()
+	defer counter.Unlock()
+	writeHeader(buf, counter.name, "counter")
+	name := counter.name.Name + "_total"
+	if len(counter.values) == 0 {
+		buf.WriteString(sampleLine(name, parentLabels, 0))
+		buf.WriteString("\n")
+		return
+	}
+	for _, v := range counter.values {
+		buf.WriteString(sampleLine(name, joinLabels(parentLabels, labelsToString(v.labels)), v.total()))
+		if v.exemplar != nil {
+			fmt.Fprintf(buf, " # {%s} %s %f", labelsToString(v.exemplar.labels), formatValue(v.total()), float64(v.exemplar.ts.UnixNano())/1e9)
+		}
+		buf.WriteString("\n")
+	}
+}
+
+// Snapshot captures the counter's current value with a single read,
+// rendering it immediately so a TransactionalGatherer never re-reads the
+// counter's live state after the fact.
+func (counter *Counter) Snapshot(parentLabels string) MetricFamily {
+	var buf strings.Builder
+	counter.WriteMetric(&buf, parentLabels)
+	return MetricFamily{Name: counter.name.Name, Text: buf.String()}
+}
+
+// SnapshotOpenMetric is Snapshot's OpenMetrics analogue: it captures the
+// counter's current value and most recent exemplar with a single read,
+// so a TransactionalGatherer's OpenMetrics scrapes are just as
+// internally consistent as its classic ones.
+func (counter *Counter) SnapshotOpenMetric(parentLabels string) MetricFamily {
+	var buf strings.Builder
+	counter.WriteOpenMetric(&buf, parentLabels)
+	return MetricFamily{Name: counter.name.Name, Text: buf.String()}
+}
+
+// Deregister removes the counter from registry, or from DefaultRegistry
+// if registry is nil.
+func (counter *Counter) Deregister(registry *Registry) {
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	registry.Unregister(counter)
+}
+
+// writeHeader renders the shared "# HELP ...\n# TYPE ... <kind>\n"
+// preamble common to every metric kind.
+func writeHeader(buf *strings.Builder, name MetricName, kind string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name.Name, name.Description)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name.Name, kind)
+}
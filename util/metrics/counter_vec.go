@@ -0,0 +1,194 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// counterVecShardCount is the number of stripes children are spread
+// across, keeping lookup contention low during warm-up without paying
+// for a full lock-free map. It must stay a power of two.
+const counterVecShardCount = 64
+
+// counterVecChild is one resolved label-set's storage: value and
+// floatBits are what the Counter handed back to the caller atomically
+// increments, independent of Counter's usual mutex-guarded map. key is
+// the label-set's canonical rendering (its fully merged labels, as
+// produced by labelMap), used to dedupe a label-set resolved through a
+// CurriedCounterVec against the same label-set resolved through its
+// parent.
+type counterVecChild struct {
+	key       string
+	value     uint64
+	floatBits uint64
+	counter   *Counter
+}
+
+type counterVecShard struct {
+	mu sync.Mutex
+	// children is scanned linearly on a lookup miss; collisions are rare
+	// with 64 shards and scans only ever happen before a caller has
+	// cached its *Counter.
+	children []*counterVecChild
+}
+
+// CounterVec is a pre-declared family of counters sharing a fixed set of
+// label names, for hot paths (txn pool admission, gossip message
+// receipt, ...) where Counter's per-call label map allocation and mutex
+// are too costly. Resolve each label-set once via WithLabelValues and
+// cache the returned *Counter; its Inc/Add then become a single atomic
+// operation with no further map lookup.
+type CounterVec struct {
+	name       MetricName
+	labelNames []string
+	curried    map[string]string
+	shards     [counterVecShardCount]*counterVecShard
+}
+
+// MakeCounterVec creates a CounterVec over labelNames and registers it
+// with the DefaultRegistry.
+func MakeCounterVec(name MetricName, labelNames []string) *CounterVec {
+	v := &CounterVec{name: name, labelNames: labelNames}
+	for i := range v.shards {
+		v.shards[i] = &counterVecShard{}
+	}
+	DefaultRegistry.Register(v)
+	return v
+}
+
+// shardIndexForKey hashes a label-set's canonical rendering (see
+// counterVecChild.key) to choose its shard. Hashing the canonical,
+// fully-merged key rather than the raw values passed to WithLabelValues
+// guarantees a label-set lands in the same shard, and is recognized as
+// the same child, regardless of whether it was resolved through the
+// parent CounterVec or through a CurriedCounterVec.
+func shardIndexForKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum64() & (counterVecShardCount - 1)
+}
+
+func (v *CounterVec) labelMap(values []string) map[string]string {
+	labels := make(map[string]string, len(v.labelNames)+len(v.curried))
+	for k, val := range v.curried {
+		labels[k] = val
+	}
+	for i, name := range v.labelNames {
+		if i < len(values) {
+			labels[name] = values[i]
+		}
+	}
+	return labels
+}
+
+// WithLabelValues returns the child Counter bound to values, matched
+// positionally against labelNames (or the remaining, uncurried names on
+// a CurriedCounterVec), creating it on first use. Callers should cache
+// the result: every call after the first pays only a shard lookup, not a
+// lock shared with every other label-set.
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	merged := v.labelMap(values)
+	key := labelsToString(merged)
+
+	shard := v.shards[shardIndexForKey(key)]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	for _, c := range shard.children {
+		if c.key == key {
+			return c.counter
+		}
+	}
+	child := &counterVecChild{key: key}
+	child.counter = &Counter{
+		name:          v.name,
+		fastValue:     &child.value,
+		fastFloatBits: &child.floatBits,
+		fastLabels:    merged,
+	}
+	shard.children = append(shard.children, child)
+	return child.counter
+}
+
+// CurriedCounterVec is a CounterVec with some label values pre-bound via
+// CurryWith; WithLabelValues on it only needs the remaining labels.
+type CurriedCounterVec struct {
+	*CounterVec
+}
+
+// CurryWith returns a partial CounterVec with labels pre-bound, matching
+// the ergonomics of Prometheus's CounterVec. The returned value shares
+// the parent's shards, so children resolved through either are rendered
+// exactly once by the parent's WriteMetric.
+func (v *CounterVec) CurryWith(labels map[string]string) *CurriedCounterVec {
+	curried := make(map[string]string, len(v.curried)+len(labels))
+	for k, val := range v.curried {
+		curried[k] = val
+	}
+	for k, val := range labels {
+		curried[k] = val
+	}
+	remaining := make([]string, 0, len(v.labelNames))
+	for _, name := range v.labelNames {
+		if _, ok := curried[name]; !ok {
+			remaining = append(remaining, name)
+		}
+	}
+	return &CurriedCounterVec{&CounterVec{
+		name:       v.name,
+		labelNames: remaining,
+		curried:    curried,
+		shards:     v.shards,
+	}}
+}
+
+// WriteMetric renders every resolved child counter, classic Prometheus
+// style, identically to Counter.WriteMetric.
+func (v *CounterVec) WriteMetric(buf *strings.Builder, parentLabels string) {
+	writeHeader(buf, v.name, "counter")
+	for _, shard := range v.shards {
+		shard.mu.Lock()
+		for _, child := range shard.children {
+			total := float64(atomic.LoadUint64(&child.value)) + math.Float64frombits(atomic.LoadUint64(&child.floatBits))
+			buf.WriteString(sampleLine(v.name.Name, joinLabels(parentLabels, labelsToString(child.counter.fastLabels)), total))
+			buf.WriteString("\n")
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// Snapshot captures every resolved child's current value with a single
+// read, rendering it immediately so a TransactionalGatherer never
+// re-reads the vec's live state after the fact.
+func (v *CounterVec) Snapshot(parentLabels string) MetricFamily {
+	var buf strings.Builder
+	v.WriteMetric(&buf, parentLabels)
+	return MetricFamily{Name: v.name.Name, Text: buf.String()}
+}
+
+// Deregister removes the CounterVec from registry, or from
+// DefaultRegistry if registry is nil.
+func (v *CounterVec) Deregister(registry *Registry) {
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	registry.Unregister(v)
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algorand/go-algorand/test/partitiontest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterVecWithLabelValues(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	vec := MakeCounterVec(MetricName{Name: "vec_test_counter", Description: "vec test"}, []string{"result"})
+	defer vec.Deregister(nil)
+
+	ok := vec.WithLabelValues("ok")
+	err := vec.WithLabelValues("error")
+	require.Same(t, ok, vec.WithLabelValues("ok"), "WithLabelValues must return the cached child on repeat calls")
+
+	for i := 0; i < 5; i++ {
+		ok.Inc(nil)
+	}
+	err.Inc(nil)
+
+	require.Equal(t, uint64(5), ok.GetUint64Value())
+	require.Equal(t, uint64(1), err.GetUint64Value())
+
+	var buf strings.Builder
+	vec.WriteMetric(&buf, "")
+	out := buf.String()
+	require.Contains(t, out, `vec_test_counter{result="ok"} 5`)
+	require.Contains(t, out, `vec_test_counter{result="error"} 1`)
+}
+
+func TestCounterVecCurryWith(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	vec := MakeCounterVec(MetricName{Name: "vec_curry_test_counter", Description: "vec curry test"}, []string{"proto", "result"})
+	defer vec.Deregister(nil)
+
+	tcp := vec.CurryWith(map[string]string{"proto": "tcp"})
+	c := tcp.WithLabelValues("ok")
+	c.Inc(nil)
+	c.Inc(nil)
+
+	var buf strings.Builder
+	vec.WriteMetric(&buf, "")
+	require.Contains(t, buf.String(), `vec_curry_test_counter{proto="tcp",result="ok"} 2`)
+}
+
+func TestCounterVecCurryWithDedupesAgainstParent(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	vec := MakeCounterVec(MetricName{Name: "vec_curry_dedup_test_counter", Description: "vec curry dedup test"}, []string{"proto", "result"})
+	defer vec.Deregister(nil)
+
+	tcp := vec.CurryWith(map[string]string{"proto": "tcp"})
+	tcp.WithLabelValues("ok").Inc(nil)
+	// Resolving the identical label-set through the parent must return
+	// the same child, not a second one.
+	vec.WithLabelValues("tcp", "ok").Inc(nil)
+
+	var buf strings.Builder
+	vec.WriteMetric(&buf, "")
+	out := buf.String()
+	require.Equal(t, 1, strings.Count(out, `vec_curry_dedup_test_counter{proto="tcp",result="ok"}`),
+		"the same label-set resolved via a curried vec and its parent must render exactly once")
+	require.Contains(t, out, `vec_curry_dedup_test_counter{proto="tcp",result="ok"} 2`)
+}
+
+func TestCounterVecAddWithExemplarRejected(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	vec := MakeCounterVec(MetricName{Name: "vec_exemplar_test_counter", Description: "vec exemplar test"}, []string{"result"})
+	defer vec.Deregister(nil)
+
+	child := vec.WithLabelValues("ok")
+	err := child.AddWithExemplar(1, nil, map[string]string{"trace_id": "abc"}, "", time.Time{})
+	require.Error(t, err)
+}
+
+func TestCounterVecAddPreservesFraction(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	vec := MakeCounterVec(MetricName{Name: "vec_fraction_test_counter", Description: "vec fraction test"}, []string{"result"})
+	defer vec.Deregister(nil)
+
+	child := vec.WithLabelValues("ok")
+	child.Add(0.5, nil)
+	child.Add(0.25, nil)
+
+	var buf strings.Builder
+	vec.WriteMetric(&buf, "")
+	require.Contains(t, buf.String(), `vec_fraction_test_counter{result="ok"} 0.75`)
+}
+
+func BenchmarkCounterMapInc(b *testing.B) {
+	counter := MakeCounter(MetricName{Name: "bench_counter_map", Description: "benchmark"})
+	defer counter.Deregister(nil)
+	labels := map[string]string{"result": "ok"}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			counter.Inc(labels)
+		}
+	})
+}
+
+func BenchmarkCounterVecInc(b *testing.B) {
+	vec := MakeCounterVec(MetricName{Name: "bench_counter_vec", Description: "benchmark"}, []string{"result"})
+	defer vec.Deregister(nil)
+	child := vec.WithLabelValues("ok")
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			child.Inc(nil)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"strings"
+
+	"github.com/algorand/go-deadlock"
+)
+
+// gaugeValue tracks one label-set's current value.
+type gaugeValue struct {
+	value  float64
+	labels map[string]string
+}
+
+// Gauge is a metric whose value can move up or down, broken down by an
+// arbitrary set of labels supplied at call time.
+type Gauge struct {
+	deadlock.Mutex
+	name   MetricName
+	values map[string]*gaugeValue
+}
+
+// MakeGauge creates a new Gauge and registers it with the
+// DefaultRegistry.
+func MakeGauge(name MetricName) *Gauge {
+	g := &Gauge{
+		name:   name,
+		values: make(map[string]*gaugeValue),
+	}
+	DefaultRegistry.Register(g)
+	return g
+}
+
+func (gauge *Gauge) valueFor(labels map[string]string) *gaugeValue {
+	key := labelsToString(labels)
+	v, ok := gauge.values[key]
+	if !ok {
+		v = &gaugeValue{labels: labels}
+		gauge.values[key] = v
+	}
+	return v
+}
+
+// Set replaces the gauge's current value for the given label-set.
+func (gauge *Gauge) Set(value float64, labels map[string]string) {
+	gauge.Lock()
+	defer gauge.Unlock()
+	gauge.valueFor(labels).value = value
+}
+
+// Inc increases the gauge for the given label-set by one.
+func (gauge *Gauge) Inc(labels map[string]string) {
+	gauge.Lock()
+	defer gauge.Unlock()
+	gauge.valueFor(labels).value++
+}
+
+// Dec decreases the gauge for the given label-set by one.
+func (gauge *Gauge) Dec(labels map[string]string) {
+	gauge.Lock()
+	defer gauge.Unlock()
+	gauge.valueFor(labels).value--
+}
+
+// WriteMetric writes the gauge in classic Prometheus text exposition
+// format.
+func (gauge *Gauge) WriteMetric(buf *strings.Builder, parentLabels string) {
+	gauge.Lock()
+	defer gauge.Unlock()
+	writeHeader(buf, gauge.name, "gauge")
+	if len(gauge.values) == 0 {
+		buf.WriteString(sampleLine(gauge.name.Name, parentLabels, 0))
+		buf.WriteString("\n")
+		return
+	}
+	for _, v := range gauge.values {
+		buf.WriteString(sampleLine(gauge.name.Name, joinLabels(parentLabels, labelsToString(v.labels)), v.value))
+		buf.WriteString("\n")
+	}
+}
+
+// WriteOpenMetric writes the gauge in OpenMetrics text format. Gauges
+// carry no exemplars, so this renders identically to WriteMetric.
+func (gauge *Gauge) WriteOpenMetric(buf *strings.Builder, parentLabels string) {
+	gauge.WriteMetric(buf, parentLabels)
+}
+
+// Snapshot captures the gauge's current values with a single read,
+// rendering it immediately so a TransactionalGatherer never re-reads the
+// gauge's live state after the fact.
+func (gauge *Gauge) Snapshot(parentLabels string) MetricFamily {
+	var buf strings.Builder
+	gauge.WriteMetric(&buf, parentLabels)
+	return MetricFamily{Name: gauge.name.Name, Text: buf.String()}
+}
+
+// Deregister removes the gauge from registry, or from DefaultRegistry if
+// registry is nil.
+func (gauge *Gauge) Deregister(registry *Registry) {
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	registry.Unregister(gauge)
+}
@@ -0,0 +1,204 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/algorand/go-deadlock"
+)
+
+// DefBuckets are the default Prometheus histogram buckets, suitable for
+// measuring sub-10-second request/processing latencies.
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// LinearBuckets returns count buckets, each width wide, the first with
+// an upper bound of start.
+func LinearBuckets(start, width float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start += width
+	}
+	return buckets
+}
+
+// ExponentialBuckets returns count buckets, the first with an upper
+// bound of start, each subsequent bound factor times the previous one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// histogramValue tracks one label-set's bucket counts, sum and total
+// observation count. Each bucket is independent (non-cumulative):
+// buckets[i] counts only observations landing in (upperBounds[i-1],
+// upperBounds[i]], and the last entry is the overflow (+Inf) bucket.
+// WriteMetric sums them into the cumulative counts Prometheus expects at
+// render time. Bucket counts and the observation count are updated with
+// atomic.AddUint64 rather than under a lock; the float64 sum is
+// protected by its own mutex since Go has no atomic float64 add, and
+// Observe also takes the Histogram's mutex to look up the label-set.
+// Keeping each bucket independent (rather than bumping every bucket >=
+// the matched one) means a single Observe call touches a single bucket
+// word, so a concurrent WriteMetric/Snapshot can never observe a
+// momentarily non-monotonic cumulative histogram.
+type histogramValue struct {
+	buckets []uint64
+	count   uint64
+	sumMu   deadlock.Mutex
+	sum     float64
+	labels  map[string]string
+}
+
+// Histogram is a metric that samples observations (e.g. request
+// durations) into configurable cumulative buckets, broken down by an
+// arbitrary set of labels supplied at call time.
+type Histogram struct {
+	name         MetricName
+	upperBounds  []float64
+	staticLabels map[string]string
+
+	mu     deadlock.Mutex
+	values map[string]*histogramValue
+}
+
+// MakeHistogram creates a new Histogram with the given cumulative bucket
+// upper bounds (which must be sorted ascending; a +Inf bucket is added
+// implicitly) and registers it with the DefaultRegistry. labels are
+// attached to every series this histogram reports, in addition to each
+// Observe call's own labels.
+func MakeHistogram(name MetricName, buckets []float64, labels map[string]string) *Histogram {
+	h := &Histogram{
+		name:         name,
+		upperBounds:  buckets,
+		staticLabels: labels,
+		values:       make(map[string]*histogramValue),
+	}
+	DefaultRegistry.Register(h)
+	return h
+}
+
+func (h *Histogram) mergedLabels(labels map[string]string) map[string]string {
+	if len(h.staticLabels) == 0 {
+		return labels
+	}
+	merged := make(map[string]string, len(h.staticLabels)+len(labels))
+	for k, v := range h.staticLabels {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return merged
+}
+
+func (h *Histogram) valueFor(labels map[string]string) *histogramValue {
+	merged := h.mergedLabels(labels)
+	key := labelsToString(merged)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	v, ok := h.values[key]
+	if !ok {
+		v = &histogramValue{
+			buckets: make([]uint64, len(h.upperBounds)+1),
+			labels:  merged,
+		}
+		h.values[key] = v
+	}
+	return v
+}
+
+// Observe records a single sample, bucketing it and adding it to the
+// label-set's running sum.
+func (h *Histogram) Observe(v float64, labels map[string]string) {
+	hv := h.valueFor(labels)
+	idx := sort.SearchFloat64s(h.upperBounds, v)
+	atomic.AddUint64(&hv.buckets[idx], 1)
+	atomic.AddUint64(&hv.count, 1)
+	hv.sumMu.Lock()
+	hv.sum += v
+	hv.sumMu.Unlock()
+}
+
+// ObserveDuration records the elapsed time since start, in seconds, as a
+// single sample.
+func (h *Histogram) ObserveDuration(start time.Time, labels map[string]string) {
+	h.Observe(time.Since(start).Seconds(), labels)
+}
+
+// WriteMetric writes the histogram in classic Prometheus text exposition
+// format: one HELP/TYPE header followed by, per label-set, one
+// "_bucket{le=...}" line per configured bucket (plus the implicit +Inf
+// bucket), then "_sum" and "_count" lines. Each bucket line's value is
+// the running sum of every bucket up to and including it, so it's
+// cumulative even though histogramValue stores independent per-bucket
+// counts.
+func (h *Histogram) WriteMetric(buf *strings.Builder, parentLabels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(buf, h.name, "histogram")
+	for _, v := range h.values {
+		ownLabels := labelsToString(v.labels)
+		var cumulative uint64
+		for i, bound := range h.upperBounds {
+			cumulative += atomic.LoadUint64(&v.buckets[i])
+			le := fmt.Sprintf(`le=%q`, formatValue(bound))
+			buf.WriteString(sampleLine(h.name.Name+"_bucket", joinLabels(parentLabels, joinLabels(ownLabels, le)), float64(cumulative)))
+			buf.WriteString("\n")
+		}
+		cumulative += atomic.LoadUint64(&v.buckets[len(h.upperBounds)])
+		infLe := `le="+Inf"`
+		buf.WriteString(sampleLine(h.name.Name+"_bucket", joinLabels(parentLabels, joinLabels(ownLabels, infLe)), float64(cumulative)))
+		buf.WriteString("\n")
+
+		v.sumMu.Lock()
+		sum := v.sum
+		v.sumMu.Unlock()
+		buf.WriteString(sampleLine(h.name.Name+"_sum", joinLabels(parentLabels, ownLabels), sum))
+		buf.WriteString("\n")
+		buf.WriteString(sampleLine(h.name.Name+"_count", joinLabels(parentLabels, ownLabels), float64(atomic.LoadUint64(&v.count))))
+		buf.WriteString("\n")
+	}
+}
+
+// Snapshot captures every label-set's buckets, sum and count with a
+// single read, rendering it immediately so a TransactionalGatherer never
+// re-reads the histogram's live state after the fact.
+func (h *Histogram) Snapshot(parentLabels string) MetricFamily {
+	var buf strings.Builder
+	h.WriteMetric(&buf, parentLabels)
+	return MetricFamily{Name: h.name.Name, Text: buf.String()}
+}
+
+// Deregister removes the histogram from registry, or from
+// DefaultRegistry if registry is nil.
+func (h *Histogram) Deregister(registry *Registry) {
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	registry.Unregister(h)
+}
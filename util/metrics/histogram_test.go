@@ -0,0 +1,101 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algorand/go-algorand/test/partitiontest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramObserveBucketPlacement(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	h := MakeHistogram(MetricName{Name: "histogram_test_latency", Description: "latency test"}, []float64{1, 2, 5}, nil)
+	defer h.Deregister(nil)
+
+	// 0.5 falls in the first bucket, 1.5 in the second, 10 overflows
+	// into +Inf; each le bucket must report the cumulative count of
+	// every bucket up to and including it.
+	h.Observe(0.5, nil)
+	h.Observe(1.5, nil)
+	h.Observe(10, nil)
+
+	var buf strings.Builder
+	h.WriteMetric(&buf, "")
+	out := buf.String()
+
+	require.Contains(t, out, `histogram_test_latency_bucket{le="1"} 1`)
+	require.Contains(t, out, `histogram_test_latency_bucket{le="2"} 2`)
+	require.Contains(t, out, `histogram_test_latency_bucket{le="5"} 2`)
+	require.Contains(t, out, `histogram_test_latency_bucket{le="+Inf"} 3`)
+	require.Contains(t, out, `histogram_test_latency_sum 12`)
+	require.Contains(t, out, `histogram_test_latency_count 3`)
+}
+
+func TestHistogramObserveExactBoundary(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	h := MakeHistogram(MetricName{Name: "histogram_test_boundary", Description: "boundary test"}, []float64{1, 2}, nil)
+	defer h.Deregister(nil)
+
+	// A sample exactly at a bucket's upper bound belongs in that bucket,
+	// not the next one (le means "<=").
+	h.Observe(1, nil)
+
+	var buf strings.Builder
+	h.WriteMetric(&buf, "")
+	out := buf.String()
+
+	require.Contains(t, out, `histogram_test_boundary_bucket{le="1"} 1`)
+	require.Contains(t, out, `histogram_test_boundary_bucket{le="2"} 1`)
+	require.Contains(t, out, `histogram_test_boundary_bucket{le="+Inf"} 1`)
+}
+
+func TestHistogramObserveDuration(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	h := MakeHistogram(MetricName{Name: "histogram_test_duration", Description: "duration test"}, DefBuckets, nil)
+	defer h.Deregister(nil)
+
+	h.ObserveDuration(time.Now().Add(-time.Millisecond), nil)
+
+	var buf strings.Builder
+	h.WriteMetric(&buf, "")
+	require.Contains(t, buf.String(), `histogram_test_duration_count 1`)
+}
+
+func TestLinearBuckets(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	require.Equal(t, []float64{1, 3, 5, 7}, LinearBuckets(1, 2, 4))
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	require.Equal(t, []float64{1, 2, 4, 8}, ExponentialBuckets(1, 2, 4))
+}
+
+func TestDefBuckets(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	require.Equal(t, []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}, DefBuckets)
+}
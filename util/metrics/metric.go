@@ -0,0 +1,90 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetricName identifies a metric for reporting purposes; Description is
+// rendered as the Prometheus/OpenMetrics HELP line.
+type MetricName struct {
+	Name        string
+	Description string
+}
+
+// Metric is implemented by every exported metric type (Counter, Gauge,
+// ...). WriteMetric renders the metric's current value(s) in classic
+// Prometheus text exposition format, with parentLabels (the service-wide
+// labels from ServiceConfig) prefixed onto each sample's own labels.
+type Metric interface {
+	WriteMetric(buf *strings.Builder, parentLabels string)
+	Deregister(registry *Registry)
+}
+
+// labelsToString renders a label map as a sorted, comma-separated
+// key="value" list suitable for embedding inside a metric's curly
+// braces. A nil or empty map renders as the empty string.
+func labelsToString(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf(`%s=%q`, k, labels[k]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// joinLabels combines two already-rendered label strings (service-wide
+// labels and a metric's own per-call labels), omitting either side if
+// empty.
+func joinLabels(parentLabels, ownLabels string) string {
+	switch {
+	case parentLabels == "":
+		return ownLabels
+	case ownLabels == "":
+		return parentLabels
+	default:
+		return parentLabels + "," + ownLabels
+	}
+}
+
+// formatValue renders a sample value the way Prometheus/OpenMetrics
+// expect: the shortest decimal representation that round-trips, with no
+// forced trailing zeros (e.g. "4", "2.3", "35.5").
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// sampleLine renders a single exposition line, without its trailing
+// newline, so callers can append an OpenMetrics exemplar suffix before
+// terminating it themselves.
+func sampleLine(name, labels string, value float64) string {
+	if labels == "" {
+		return fmt.Sprintf("%s %s", name, formatValue(value))
+	}
+	return fmt.Sprintf("%s{%s} %s", name, labels, formatValue(value))
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algorand/go-algorand/test/partitiontest"
+	"github.com/stretchr/testify/require"
+)
+
+// scrape issues a single /metrics GET against service, optionally
+// negotiating OpenMetrics via the Accept header, and returns the
+// response's Content-Type and body.
+func scrape(t *testing.T, address string, openMetrics bool) (string, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/metrics", address), nil)
+	require.NoError(t, err)
+	if openMetrics {
+		req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.Header.Get("Content-Type"), string(body)
+}
+
+func TestOpenMetricsNegotiationAndEOF(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	test := NewMetricTest()
+	port := test.createListener("127.0.0.1:0")
+	address := fmt.Sprintf("localhost:%d", port)
+
+	metricService := MakeMetricService(&ServiceConfig{NodeExporterListenAddress: address})
+	metricService.Start(context.Background())
+	defer metricService.Shutdown()
+	// give the HTTP listener a moment to come up, the same way other
+	// tests in this package wait out a sample cycle before scraping.
+	time.Sleep(test.sampleRate)
+
+	counter := MakeCounter(MetricName{Name: "openmetrics_test_counter", Description: "openmetrics negotiation test"})
+	defer counter.Deregister(nil)
+	counter.Inc(nil)
+
+	classicContentType, classicBody := scrape(t, address, false)
+	require.Contains(t, classicContentType, "text/plain")
+	require.Contains(t, classicBody, "openmetrics_test_counter 1\n")
+	require.NotContains(t, classicBody, "# EOF")
+
+	openContentType, openBody := scrape(t, address, true)
+	require.Contains(t, openContentType, "application/openmetrics-text")
+	require.Contains(t, openBody, "openmetrics_test_counter_total 1")
+	require.True(t, strings.HasSuffix(openBody, "# EOF\n"), "OpenMetrics responses must be terminated with a # EOF trailer")
+}
+
+func TestAddWithExemplarRejectsOversizedExemplar(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	c := MakeCounter(MetricName{Name: "exemplar_size_test_counter", Description: "exemplar size test"})
+	defer c.Deregister(nil)
+
+	oversized := map[string]string{"trace_id": strings.Repeat("a", ExemplarMaxRunes+1)}
+	err := c.AddWithExemplar(1, nil, oversized, "", time.Now())
+	require.Error(t, err)
+
+	// The counter must not have been incremented by a rejected exemplar.
+	// AddWithExemplar only ever writes into floatValue, so assert against
+	// the rendered total rather than GetUint64Value (which only ever
+	// reads intValue and would read 0 either way).
+	var buf strings.Builder
+	c.WriteMetric(&buf, "")
+	require.Contains(t, buf.String(), "exemplar_size_test_counter 0\n")
+}
+
+func TestAddWithExemplarRendersSuffixLine(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	c := MakeCounter(MetricName{Name: "exemplar_render_test_counter", Description: "exemplar render test"})
+	defer c.Deregister(nil)
+
+	ts := time.Unix(1700000000, 500000000)
+	require.NoError(t, c.AddWithExemplar(1, nil, map[string]string{"trace_id": "abc123"}, "", ts))
+
+	var buf strings.Builder
+	c.WriteOpenMetric(&buf, "")
+	require.Contains(t, buf.String(), `exemplar_render_test_counter_total 1 # {trace_id="abc123"} 1 1700000000.500000`)
+}
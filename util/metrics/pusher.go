@@ -0,0 +1,166 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/algorand/go-deadlock"
+)
+
+// Pusher pushes a set of metrics to a Prometheus Pushgateway (or
+// anything speaking its HTTP API), for short-lived processes that exit
+// before a scrape would ever reach them.
+type Pusher struct {
+	baseURL   string
+	job       string
+	groupings map[string]string
+
+	username, password string
+	client             *http.Client
+
+	deadlock.Mutex
+	collectors []Metric
+	lastErr    error
+}
+
+// NewPusher creates a Pusher targeting the Pushgateway at url, reporting
+// under the given job name.
+func NewPusher(pushgatewayURL, job string) *Pusher {
+	return &Pusher{
+		baseURL:   strings.TrimRight(pushgatewayURL, "/"),
+		job:       job,
+		groupings: make(map[string]string),
+		client:    http.DefaultClient,
+	}
+}
+
+// Grouping adds a grouping key label/value pair to the push URL, letting
+// the gateway distinguish multiple instances reporting under the same
+// job.
+func (p *Pusher) Grouping(label, value string) *Pusher {
+	p.groupings[label] = value
+	return p
+}
+
+// Collector registers a metric to be included in every subsequent Push
+// or Add call.
+func (p *Pusher) Collector(c Metric) *Pusher {
+	p.Lock()
+	defer p.Unlock()
+	p.collectors = append(p.collectors, c)
+	return p
+}
+
+// BasicAuth configures HTTP basic auth credentials for the push request.
+func (p *Pusher) BasicAuth(username, password string) *Pusher {
+	p.username, p.password = username, password
+	return p
+}
+
+// Client overrides the http.Client used to issue push requests; the
+// default is http.DefaultClient.
+func (p *Pusher) Client(client *http.Client) *Pusher {
+	p.client = client
+	return p
+}
+
+// pushURL builds the Pushgateway API URL for this job and its grouping
+// key, e.g. "<url>/metrics/job/<job>/<label>/<value>/...". Grouping
+// labels are sorted so the URL is deterministic across calls, the same
+// way client_golang's push package sorts them.
+func (p *Pusher) pushURL() string {
+	labels := make([]string, 0, len(p.groupings))
+	for label := range p.groupings {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	segments := []string{p.baseURL, "metrics", "job", url.PathEscape(p.job)}
+	for _, label := range labels {
+		segments = append(segments, url.PathEscape(label), url.PathEscape(p.groupings[label]))
+	}
+	return strings.Join(segments, "/")
+}
+
+// Push replaces the Pushgateway's stored metrics for this job/grouping
+// with the current values of every registered collector (PUT semantics).
+func (p *Pusher) Push(ctx context.Context) error {
+	return p.do(ctx, http.MethodPut)
+}
+
+// Add merges the current values of every registered collector into
+// whatever the Pushgateway already has stored for this job/grouping
+// (POST semantics).
+func (p *Pusher) Add(ctx context.Context) error {
+	return p.do(ctx, http.MethodPost)
+}
+
+// Error returns the error from the most recent Push or Add call, or nil
+// if it succeeded (or none has been made yet).
+func (p *Pusher) Error() error {
+	p.Lock()
+	defer p.Unlock()
+	return p.lastErr
+}
+
+func (p *Pusher) do(ctx context.Context, method string) error {
+	p.Lock()
+	collectors := make([]Metric, len(p.collectors))
+	copy(collectors, p.collectors)
+	p.Unlock()
+
+	var buf strings.Builder
+	for _, c := range collectors {
+		c.WriteMetric(&buf, "")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.pushURL(), strings.NewReader(buf.String()))
+	if err != nil {
+		p.setErr(err)
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if p.username != "" || p.password != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		p.setErr(err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		err = fmt.Errorf("metrics: push to %s failed: %s", p.pushURL(), resp.Status)
+		p.setErr(err)
+		return err
+	}
+	p.setErr(nil)
+	return nil
+}
+
+func (p *Pusher) setErr(err error) {
+	p.Lock()
+	defer p.Unlock()
+	p.lastErr = err
+}
@@ -0,0 +1,111 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/algorand/go-algorand/test/partitiontest"
+	"github.com/stretchr/testify/require"
+)
+
+type PusherTest struct {
+	method string
+	path   string
+	body   string
+}
+
+func TestPusherPush(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	var got PusherTest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		got = PusherTest{method: r.Method, path: r.URL.Path, body: string(body)}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	counter := MakeCounter(MetricName{Name: "pusher_test_counter", Description: "this is the metric test for the pusher"})
+	counter.Deregister(nil) // keep it out of DefaultRegistry; the pusher has its own collector list
+	counter.Inc(nil)
+	counter.Inc(nil)
+
+	pusher := NewPusher(server.URL, "batchtool").Grouping("instance", "test-1").Collector(counter)
+	err := pusher.Push(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, pusher.Error())
+
+	require.Equal(t, http.MethodPut, got.method)
+	require.Equal(t, "/metrics/job/batchtool/instance/test-1", got.path)
+	require.Contains(t, got.body, "pusher_test_counter 2\n")
+}
+
+func TestPusherPushSortsGroupings(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	pusher := NewPusher(server.URL, "batchtool").Grouping("zone", "us-east").Grouping("instance", "test-1")
+	for i := 0; i < 5; i++ {
+		require.NoError(t, pusher.Push(context.Background()))
+		require.Equal(t, "/metrics/job/batchtool/instance/test-1/zone/us-east", path,
+			"grouping labels must be sorted into a deterministic URL regardless of map iteration order")
+	}
+}
+
+func TestPusherAddUsesPost(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	var method string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	counter := MakeCounter(MetricName{Name: "pusher_test_counter_add", Description: "this is the metric test for the pusher"})
+	counter.Deregister(nil)
+
+	pusher := NewPusher(server.URL, "batchtool").Collector(counter)
+	require.NoError(t, pusher.Add(context.Background()))
+	require.Equal(t, http.MethodPost, method)
+}
+
+func TestPusherErrorOnFailure(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	pusher := NewPusher(server.URL, "batchtool")
+	err := pusher.Push(context.Background())
+	require.Error(t, err)
+	require.Equal(t, err, pusher.Error())
+}
@@ -0,0 +1,272 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Registry tracks every metric created via MakeCounter/MakeGauge/... so
+// that a MetricService can render them all on each scrape. It also holds
+// any Sinks registered to receive a live feed of counter deltas.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []Metric
+
+	sinksMu  sync.Mutex
+	sinks    []Sink
+	hasSinks int32 // atomic; lets dispatchCount skip locking when no sink is configured
+}
+
+// NewRegistry creates an empty Registry. Most callers register into
+// DefaultRegistry instead of creating their own.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a metric to the registry; it is a no-op if the metric is
+// already registered.
+func (r *Registry) Register(m Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.metrics {
+		if existing == m {
+			return
+		}
+	}
+	r.metrics = append(r.metrics, m)
+}
+
+// Unregister removes a metric from the registry.
+func (r *Registry) Unregister(m Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.metrics {
+		if existing == m {
+			r.metrics = append(r.metrics[:i], r.metrics[i+1:]...)
+			return
+		}
+	}
+}
+
+// All returns a snapshot of the currently registered metrics.
+func (r *Registry) All() []Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Metric, len(r.metrics))
+	copy(out, r.metrics)
+	return out
+}
+
+// RegisterSink adds a Sink that every subsequent counter Add/AddUint64/
+// Inc call's delta is dispatched to, alongside the regular HTTP scrape
+// path.
+func (r *Registry) RegisterSink(s Sink) {
+	r.sinksMu.Lock()
+	defer r.sinksMu.Unlock()
+	r.sinks = append(r.sinks, s)
+	atomic.StoreInt32(&r.hasSinks, 1)
+}
+
+// UnregisterSink removes a Sink previously added via RegisterSink; it is
+// a no-op if s was never registered. Callers that own the Sink (e.g. a
+// StatsDSink dialed by MetricService) should still Close it themselves
+// afterward to release its underlying socket.
+func (r *Registry) UnregisterSink(s Sink) {
+	r.sinksMu.Lock()
+	defer r.sinksMu.Unlock()
+	for i, existing := range r.sinks {
+		if existing == s {
+			r.sinks = append(r.sinks[:i], r.sinks[i+1:]...)
+			break
+		}
+	}
+	if len(r.sinks) == 0 {
+		atomic.StoreInt32(&r.hasSinks, 0)
+	}
+}
+
+// dispatchCount forwards a counter delta to every registered sink. It's
+// a no-op (and avoids taking sinksMu) when no sink has been registered,
+// so sinkless deployments pay nothing extra on the counter hot path.
+func (r *Registry) dispatchCount(name string, labels map[string]string, delta float64) {
+	if atomic.LoadInt32(&r.hasSinks) == 0 {
+		return
+	}
+	r.sinksMu.Lock()
+	sinks := make([]Sink, len(r.sinks))
+	copy(sinks, r.sinks)
+	r.sinksMu.Unlock()
+	for _, s := range sinks {
+		s.Count(name, labels, delta)
+	}
+}
+
+// DefaultRegistry is the registry every MakeCounter/MakeGauge call
+// registers into; a metric that belongs in another Registry has to be
+// deregistered from DefaultRegistry and registered there explicitly.
+var DefaultRegistry = NewRegistry()
+
+// ServiceConfig configures a MetricService.
+type ServiceConfig struct {
+	// NodeExporterListenAddress is the address the metrics HTTP handler
+	// listens on, e.g. "localhost:9100". Leaving it empty disables the
+	// HTTP handler; a StatsDAddress, if set, still starts the StatsD sink.
+	NodeExporterListenAddress string
+
+	// Labels are attached to every metric this service reports, in
+	// addition to each metric's own per-call labels.
+	Labels map[string]string
+
+	// StatsDAddress, if set, enables a StatsD/DogStatsD Sink dialed to
+	// this host:port.
+	StatsDAddress string
+	// StatsDPrefix is prepended to every metric name sent to the sink.
+	StatsDPrefix string
+	// StatsDTagStyle selects how labels are encoded ("none", "datadog"
+	// or "influx"); it defaults to StatsDTagStyleNone.
+	StatsDTagStyle StatsDTagStyle
+	// StatsDFlushInterval is how often coalesced deltas are flushed as
+	// UDP packets; it defaults to one second.
+	StatsDFlushInterval time.Duration
+}
+
+// openMetricsContentType is the media type negotiated via the request's
+// Accept header to opt into OpenMetrics exposition (RFC draft
+// "application/openmetrics-text; version=1.0.0").
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// openMetricsWriter is implemented by metrics that can render
+// OpenMetrics-only features such as exemplars; metrics without such
+// support fall back to their classic WriteMetric implementation.
+type openMetricsWriter interface {
+	WriteOpenMetric(buf *strings.Builder, parentLabels string)
+}
+
+// MetricService exposes every metric registered in DefaultRegistry over
+// HTTP, in classic Prometheus or OpenMetrics text format depending on the
+// request's Accept header.
+type MetricService struct {
+	config *ServiceConfig
+	srv    *http.Server
+
+	statsDSink    *StatsDSink
+	sinkFlushStop chan struct{}
+	sinkFlushDone chan struct{}
+}
+
+// MakeMetricService creates a MetricService for the given configuration.
+func MakeMetricService(config *ServiceConfig) *MetricService {
+	return &MetricService{config: config}
+}
+
+// Start begins serving /metrics on the configured listen address, and,
+// if StatsDAddress is set, a StatsD Sink flushed on a ticker. It returns
+// immediately; both run until Shutdown is called.
+func (ms *MetricService) Start(ctx context.Context) {
+	if ms.config.NodeExporterListenAddress != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", ms.handle)
+		ms.srv = &http.Server{Addr: ms.config.NodeExporterListenAddress, Handler: mux}
+		go func() {
+			// ListenAndServe always returns a non-nil error; ErrServerClosed
+			// is the expected one once Shutdown is called.
+			_ = ms.srv.ListenAndServe()
+		}()
+	}
+
+	if ms.config.StatsDAddress != "" {
+		tagStyle := ms.config.StatsDTagStyle
+		if tagStyle == "" {
+			tagStyle = StatsDTagStyleNone
+		}
+		sink, err := NewStatsDSink(ms.config.StatsDAddress, ms.config.StatsDPrefix, tagStyle)
+		if err == nil {
+			ms.statsDSink = sink
+			DefaultRegistry.RegisterSink(sink)
+			interval := ms.config.StatsDFlushInterval
+			if interval <= 0 {
+				interval = time.Second
+			}
+			ms.sinkFlushStop = make(chan struct{})
+			ms.sinkFlushDone = make(chan struct{})
+			go ms.flushSinkLoop(sink, interval)
+		}
+	}
+}
+
+func (ms *MetricService) flushSinkLoop(sink Sink, interval time.Duration) {
+	defer close(ms.sinkFlushDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sink.Flush()
+		case <-ms.sinkFlushStop:
+			return
+		}
+	}
+}
+
+// Shutdown stops the HTTP server and the StatsD flush loop (if either is
+// running), blocking until both have finished, and detaches the StatsD
+// sink (if any) from DefaultRegistry and closes its socket so a
+// Start/Shutdown cycle never leaks a stale sink or an open fd.
+func (ms *MetricService) Shutdown() {
+	if ms.sinkFlushStop != nil {
+		close(ms.sinkFlushStop)
+		<-ms.sinkFlushDone
+	}
+	if ms.statsDSink != nil {
+		DefaultRegistry.UnregisterSink(ms.statsDSink)
+		_ = ms.statsDSink.Close()
+	}
+	if ms.srv == nil {
+		return
+	}
+	_ = ms.srv.Shutdown(context.Background())
+}
+
+func (ms *MetricService) handle(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	parentLabels := labelsToString(ms.config.Labels)
+
+	// Gather snapshots every collector in one pass, for both formats, so
+	// the slow part of serving this response (writing it out) happens
+	// after every metric has already been read, instead of interleaved
+	// with it.
+	families, done, _ := DefaultRegistry.Gather(parentLabels, openMetrics)
+	defer done()
+
+	var buf strings.Builder
+	for _, family := range families {
+		buf.WriteString(family.Text)
+	}
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+	w.Write([]byte(buf.String()))
+}
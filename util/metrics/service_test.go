@@ -0,0 +1,105 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// samplePollInterval paces how often MetricTest re-scrapes /metrics
+// while a test is driving counters; it has no production counterpart
+// since MetricService is a plain pull-based HTTP handler.
+const samplePollInterval = 20 * time.Millisecond
+
+// MetricTest is shared scaffolding for this package's own tests: it
+// claims a free TCP port for the caller to hand to MakeMetricService,
+// then polls the resulting /metrics endpoint on a fixed cadence,
+// recording the latest value seen for each rendered sample line.
+type MetricTest struct {
+	sync.Mutex
+	sampleRate time.Duration
+	metrics    map[string]string
+	address    string
+}
+
+// NewMetricTest creates a MetricTest ready for createListener to be
+// called on it.
+func NewMetricTest() MetricTest {
+	return MetricTest{
+		sampleRate: samplePollInterval,
+		metrics:    make(map[string]string),
+	}
+}
+
+// createListener claims a free TCP port on addr, releases it immediately
+// so the metrics HTTP server under test can bind it, and starts polling
+// that address for scrapes. It returns the claimed port number.
+func (t *MetricTest) createListener(addr string) int {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	host, _, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	t.address = net.JoinHostPort(host, fmt.Sprintf("%d", port))
+	go t.poll()
+	return port
+}
+
+func (t *MetricTest) poll() {
+	client := http.Client{Timeout: t.sampleRate}
+	ticker := time.NewTicker(t.sampleRate / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		resp, err := client.Get(fmt.Sprintf("http://%s/metrics", t.address))
+		if err != nil {
+			continue
+		}
+		t.record(resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// record parses Prometheus/OpenMetrics exposition lines out of body,
+// keeping the latest value seen for each distinct "name{labels}" sample.
+func (t *MetricTest) record(body io.Reader) {
+	scanner := bufio.NewScanner(body)
+	t.Lock()
+	defer t.Unlock()
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.LastIndex(line, " ")
+		if idx < 0 {
+			continue
+		}
+		t.metrics[line[:idx]] = line[idx+1:]
+	}
+}
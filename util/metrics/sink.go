@@ -0,0 +1,200 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/algorand/go-deadlock"
+)
+
+// Sink is an alternative metric emission backend that DefaultRegistry
+// dispatches counter deltas to as they happen, in addition to the
+// regular HTTP scrape path. Deltas are coalesced between ticks; Flush
+// sends whatever has accumulated and clears it.
+type Sink interface {
+	// Count records delta additional observations of the named counter
+	// under labels, to be coalesced and flushed on the next tick.
+	Count(name string, labels map[string]string, delta float64)
+	// Flush sends any buffered, coalesced deltas and clears them.
+	Flush()
+}
+
+// StatsDTagStyle selects how a StatsDSink encodes labels, since plain
+// StatsD has no native concept of tags.
+type StatsDTagStyle string
+
+const (
+	// StatsDTagStyleNone drops labels entirely; classic StatsD servers
+	// understand nothing else.
+	StatsDTagStyleNone StatsDTagStyle = "none"
+	// StatsDTagStyleDatadog appends "|#k:v,k:v" after the metric type,
+	// as used by DogStatsD.
+	StatsDTagStyleDatadog StatsDTagStyle = "datadog"
+	// StatsDTagStyleInflux embeds "name,k=v,k=v:value|c", as understood
+	// by Telegraf's statsd input.
+	StatsDTagStyleInflux StatsDTagStyle = "influx"
+)
+
+// defaultStatsDMTU is the default UDP payload size StatsDSink batches
+// packets up to, chosen to stay under common network MTUs after IP/UDP
+// overhead.
+const defaultStatsDMTU = 1432
+
+// statsdKey identifies one counter label-set's coalesced delta between
+// flushes.
+type statsdKey struct {
+	name string
+	tags string
+}
+
+// StatsDSink batches counter deltas and emits them as StatsD "|c" UDP
+// packets.
+type StatsDSink struct {
+	conn     net.Conn
+	prefix   string
+	tagStyle StatsDTagStyle
+	mtu      int
+
+	deadlock.Mutex
+	pending map[statsdKey]float64
+}
+
+// NewStatsDSink dials address (host:port) over UDP and returns a sink
+// that emits StatsD counter packets prefixed with prefix, encoding
+// labels per tagStyle.
+func NewStatsDSink(address, prefix string, tagStyle StatsDTagStyle) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsDSink{
+		conn:     conn,
+		prefix:   prefix,
+		tagStyle: tagStyle,
+		mtu:      defaultStatsDMTU,
+		pending:  make(map[statsdKey]float64),
+	}, nil
+}
+
+// DogStatsDSink is a StatsDSink preconfigured for DogStatsD's "|#k:v,k:v"
+// tag syntax.
+type DogStatsDSink struct {
+	*StatsDSink
+}
+
+// NewDogStatsDSink dials address over UDP and returns a DogStatsD sink
+// prefixed with prefix.
+func NewDogStatsDSink(address, prefix string) (*DogStatsDSink, error) {
+	sink, err := NewStatsDSink(address, prefix, StatsDTagStyleDatadog)
+	if err != nil {
+		return nil, err
+	}
+	return &DogStatsDSink{StatsDSink: sink}, nil
+}
+
+func (s *StatsDSink) renderTags(labels map[string]string) string {
+	if len(labels) == 0 || s.tagStyle == StatsDTagStyleNone {
+		return ""
+	}
+	if s.tagStyle == StatsDTagStyleDatadog {
+		// DogStatsD tags are "k:v", not "k=\"v\""; render them directly
+		// rather than reusing labelsToString's exposition-format quoting.
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = k + ":" + labels[k]
+		}
+		return strings.Join(parts, ",")
+	}
+	tags := labelsToString(labels)
+	if s.tagStyle == StatsDTagStyleInflux {
+		// Influx tags are "k=v", not "k=\"v\""; strip labelsToString's quotes.
+		tags = strings.ReplaceAll(tags, `"`, "")
+	}
+	return tags
+}
+
+// Count records delta additional observations of name/labels, to be
+// coalesced into a single packet on the next Flush.
+func (s *StatsDSink) Count(name string, labels map[string]string, delta float64) {
+	key := statsdKey{name: s.prefix + name, tags: s.renderTags(labels)}
+	s.Lock()
+	defer s.Unlock()
+	s.pending[key] += delta
+}
+
+func (s *StatsDSink) formatLine(key statsdKey, delta float64) string {
+	value := formatValue(delta)
+	switch s.tagStyle {
+	case StatsDTagStyleDatadog:
+		if key.tags == "" {
+			return fmt.Sprintf("%s:%s|c", key.name, value)
+		}
+		return fmt.Sprintf("%s:%s|c|#%s", key.name, value, key.tags)
+	case StatsDTagStyleInflux:
+		if key.tags == "" {
+			return fmt.Sprintf("%s:%s|c", key.name, value)
+		}
+		return fmt.Sprintf("%s,%s:%s|c", key.name, key.tags, value)
+	default:
+		return fmt.Sprintf("%s:%s|c", key.name, value)
+	}
+}
+
+// Flush sends every coalesced delta accumulated since the last Flush as
+// one or more UDP packets, batched up to the configured MTU and
+// separated by newlines, then clears the pending set.
+func (s *StatsDSink) Flush() {
+	s.Lock()
+	pending := s.pending
+	s.pending = make(map[statsdKey]float64, len(pending))
+	s.Unlock()
+
+	var batch strings.Builder
+	for key, delta := range pending {
+		line := s.formatLine(key, delta) + "\n"
+		if batch.Len() > 0 && batch.Len()+len(line) > s.mtu {
+			s.send(batch.String())
+			batch.Reset()
+		}
+		batch.WriteString(line)
+	}
+	if batch.Len() > 0 {
+		s.send(batch.String())
+	}
+}
+
+func (s *StatsDSink) send(payload string) {
+	// best-effort UDP delivery; a dropped metrics packet must never
+	// surface as an error to the caller incrementing a counter.
+	_, _ = s.conn.Write([]byte(payload))
+}
+
+// Close closes the sink's underlying UDP socket. Callers should
+// UnregisterSink it from whatever Registry it was registered with first,
+// so no further Count call races a send on the now-closed socket.
+func (s *StatsDSink) Close() error {
+	return s.conn.Close()
+}
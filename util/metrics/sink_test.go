@@ -0,0 +1,158 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algorand/go-algorand/test/partitiontest"
+	"github.com/stretchr/testify/require"
+)
+
+func readPacket(t *testing.T, conn *net.UDPConn) string {
+	t.Helper()
+	buf := make([]byte, 2048)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestStatsDSinkCoalescesBetweenFlushes(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := NewStatsDSink(conn.LocalAddr().String(), "algod.", StatsDTagStyleNone)
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		sink.Count("counter_test_name1", nil, 1)
+	}
+	sink.Flush()
+
+	require.Equal(t, "algod.counter_test_name1:20|c\n", readPacket(t, conn))
+}
+
+func TestDogStatsDSinkTagSyntax(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := NewDogStatsDSink(conn.LocalAddr().String(), "")
+	require.NoError(t, err)
+
+	sink.Count("txn_pool_remember", map[string]string{"result": "ok", "proto": "tcp"}, 3)
+	sink.Flush()
+
+	require.Equal(t, "txn_pool_remember:3|c|#proto:tcp,result:ok\n", readPacket(t, conn))
+}
+
+type countingSink struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (c *countingSink) Count(name string, labels map[string]string, delta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count++
+}
+
+func (c *countingSink) Flush() {}
+
+func TestRegistryUnregisterSink(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	registry := NewRegistry()
+	sink := &countingSink{}
+	registry.RegisterSink(sink)
+
+	registry.dispatchCount("sink_unregister_test", nil, 1)
+	registry.UnregisterSink(sink)
+	registry.dispatchCount("sink_unregister_test", nil, 1)
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	require.Equal(t, 1, sink.count, "a sink must stop receiving dispatches once unregistered")
+}
+
+func TestStatsDSinkFlushAfterCloseDoesNotPanic(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := NewStatsDSink(conn.LocalAddr().String(), "", StatsDTagStyleNone)
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+
+	// Flush must not panic just because the underlying conn is already closed.
+	sink.Count("after_close", nil, 1)
+	sink.Flush()
+}
+
+func TestMetricServiceShutdownUnregistersStatsDSink(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	metricService := MakeMetricService(&ServiceConfig{StatsDAddress: conn.LocalAddr().String()})
+	metricService.Start(context.Background())
+	require.NotNil(t, metricService.statsDSink, "Start must have dialed a StatsDSink")
+
+	metricService.Shutdown()
+
+	DefaultRegistry.sinksMu.Lock()
+	defer DefaultRegistry.sinksMu.Unlock()
+	for _, s := range DefaultRegistry.sinks {
+		require.NotSame(t, metricService.statsDSink, s, "Shutdown must unregister its StatsDSink from DefaultRegistry")
+	}
+}
+
+func TestCounterDispatchesToSink(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := NewStatsDSink(conn.LocalAddr().String(), "", StatsDTagStyleNone)
+	require.NoError(t, err)
+	DefaultRegistry.RegisterSink(sink)
+
+	counter := MakeCounter(MetricName{Name: "sink_test_counter", Description: "dispatch test"})
+	defer counter.Deregister(nil)
+
+	for i := 0; i < 5; i++ {
+		counter.Inc(nil)
+	}
+	sink.Flush()
+
+	require.Equal(t, "sink_test_counter:5|c\n", readPacket(t, conn))
+}
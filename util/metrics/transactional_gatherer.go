@@ -0,0 +1,107 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+// MetricFamily is one metric's fully rendered exposition text, captured
+// at a single point in time by Snapshot so that rendering it later never
+// re-reads the collector's live state.
+type MetricFamily struct {
+	Name string
+	Text string
+}
+
+// Snapshotter is implemented by collectors (Counter, Gauge, Histogram,
+// CounterVec) that can capture their current state into an immutable
+// MetricFamily without holding a lock for any longer than the read
+// itself takes.
+type Snapshotter interface {
+	Snapshot(parentLabels string) MetricFamily
+}
+
+// openMetricsSnapshotter is implemented by collectors that render
+// OpenMetrics-only data (currently just Counter's exemplars) and so need
+// a single-read snapshot distinct from Snapshot's classic rendering.
+type openMetricsSnapshotter interface {
+	SnapshotOpenMetric(parentLabels string) MetricFamily
+}
+
+// TransactionalGatherer produces every metric family from a single,
+// internally-consistent pass over the registry: each family reflects
+// its collector's state as of that collector's own Snapshot call, not as
+// of whenever the caller eventually gets around to writing it out, and
+// every collector has been read before the slow part of serving a scrape
+// (writing the HTTP response) begins. Collectors are snapshotted one
+// after another and updates are not paused in between, so two related
+// counters can still be captured on either side of an update; the
+// families do not form a single atomic cut across collectors.
+type TransactionalGatherer interface {
+	// Gather returns every metric family from one pass over the
+	// registry, with parentLabels applied to each as the service-wide
+	// labels. openMetrics selects OpenMetrics rendering (exemplars, the
+	// "_total" suffix) over classic Prometheus rendering. done must be
+	// called once the caller is finished with families, returning the
+	// backing slice to an internal pool.
+	Gather(parentLabels string, openMetrics bool) (families []MetricFamily, done func(), err error)
+}
+
+var metricFamilyPool = sync.Pool{
+	New: func() any { return make([]MetricFamily, 0, 16) },
+}
+
+// Gather implements TransactionalGatherer: it snapshots every registered
+// metric against parentLabels in a single pass and returns the resulting
+// families from a pooled slice. When openMetrics is set, collectors that
+// implement openMetricsSnapshotter (currently Counter, for exemplars)
+// are snapshotted through it instead of Snapshotter, so an
+// OpenMetrics-negotiating scrape is just as internally consistent as a
+// classic one.
+func (r *Registry) Gather(parentLabels string, openMetrics bool) ([]MetricFamily, func(), error) {
+	metricsSnapshot := r.All()
+
+	families := metricFamilyPool.Get().([]MetricFamily)[:0]
+	for _, m := range metricsSnapshot {
+		if openMetrics {
+			if s, ok := m.(openMetricsSnapshotter); ok {
+				families = append(families, s.SnapshotOpenMetric(parentLabels))
+				continue
+			}
+		}
+		if s, ok := m.(Snapshotter); ok {
+			families = append(families, s.Snapshot(parentLabels))
+			continue
+		}
+		var buf strings.Builder
+		if openMetrics {
+			if om, ok := m.(openMetricsWriter); ok {
+				om.WriteOpenMetric(&buf, parentLabels)
+			} else {
+				m.WriteMetric(&buf, parentLabels)
+			}
+		} else {
+			m.WriteMetric(&buf, parentLabels)
+		}
+		families = append(families, MetricFamily{Text: buf.String()})
+	}
+
+	done := func() { metricFamilyPool.Put(families[:0]) }
+	return families, done, nil
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2019-2023 Algorand, Inc.
+// This file is part of go-algorand
+//
+// go-algorand is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// go-algorand is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with go-algorand.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/algorand/go-algorand/test/partitiontest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryGather(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	registry := NewRegistry()
+	blocks := MakeCounter(MetricName{Name: "gather_test_blocks_committed_total", Description: "blocks"})
+	txns := MakeCounter(MetricName{Name: "gather_test_txns_committed_total", Description: "txns"})
+	blocks.Deregister(nil)
+	txns.Deregister(nil)
+	registry.Register(blocks)
+	registry.Register(txns)
+	defer blocks.Deregister(registry)
+	defer txns.Deregister(registry)
+
+	blocks.Inc(nil)
+	txns.AddUint64(12, nil)
+
+	families, done, err := registry.Gather(`host="h1"`, false)
+	require.NoError(t, err)
+	defer done()
+
+	require.Len(t, families, 2)
+	names := map[string]string{}
+	for _, f := range families {
+		names[f.Name] = f.Text
+	}
+	require.Contains(t, names["gather_test_blocks_committed_total"], `gather_test_blocks_committed_total{host="h1"} 1`)
+	require.Contains(t, names["gather_test_txns_committed_total"], `gather_test_txns_committed_total{host="h1"} 12`)
+}
+
+func TestRegistryGatherOpenMetricsIncludesExemplar(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	registry := NewRegistry()
+	requests := MakeCounter(MetricName{Name: "gather_test_requests_total", Description: "requests"})
+	requests.Deregister(nil)
+	registry.Register(requests)
+	defer requests.Deregister(registry)
+
+	ts := time.Unix(1700000000, 0)
+	require.NoError(t, requests.AddWithExemplar(1, nil, map[string]string{"trace_id": "abc123"}, "", ts))
+
+	families, done, err := registry.Gather("", true)
+	require.NoError(t, err)
+	defer done()
+
+	require.Len(t, families, 1)
+	require.Contains(t, families[0].Text, `gather_test_requests_total_total 1 # {trace_id="abc123"} 1 1700000000.000000`)
+}
+
+func TestRegistryGatherReusesPooledSlice(t *testing.T) {
+	partitiontest.PartitionTest(t)
+
+	registry := NewRegistry()
+	families, done, err := registry.Gather("", false)
+	require.NoError(t, err)
+	require.Empty(t, families)
+	done()
+
+	// A second Gather call should be able to reuse the pool without
+	// surfacing any stale entries from the first call.
+	families, done, err = registry.Gather("", false)
+	require.NoError(t, err)
+	require.Empty(t, families)
+	done()
+}